@@ -10,8 +10,12 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -21,17 +25,27 @@ import (
 )
 
 const (
-	MAX_CONFIG_SIZE int64 = (1024 * 1024 * 2) //2MB, even this is crazy large
+	MAX_CONFIG_SIZE        int64 = (1024 * 1024 * 2)  //2MB, even this is crazy large
+	MAX_SECRET_FILE_SIZE   int64 = (1024 * 64)        //64KiB, secrets should never be this big
+	MAX_TOTAL_INCLUDE_SIZE int64 = (1024 * 1024 * 16) //16MB across all included *.conf files
+
+	secretFilePrefix string = `@file:`
+	includeGlob      string = `*.conf`
 )
 
 type bindType int
 type readerType int
 type FollowType struct {
-	Base_Directory        string // the base directory we will be watching
-	File_Filter           string // the glob for pattern matching
-	Tag_Name              string
-	Ignore_Timestamps     bool //Just apply the current timestamp to lines as we get them
-	Assume_Local_Timezone bool
+	Base_Directory            string // the base directory we will be watching
+	File_Filter               string // the glob for pattern matching
+	Tag_Name                  string
+	Ignore_Timestamps         bool //Just apply the current timestamp to lines as we get them
+	Assume_Local_Timezone     bool
+	Multiline_Start_Regex     string // lines not matching this regex are continuations of the previous record
+	Multiline_Max_Lines       int    // flush the pending record after this many lines, regardless of the timeout
+	Multiline_Flush_Timeout   string // flush the pending record after this long with no new lines
+	Timestamp_Format_Override string // a Go time.Parse layout used in place of the current time
+	Timestamp_Regex           string // extracts the timestamp substring to feed to Timestamp_Format_Override
 }
 
 type cfgType struct {
@@ -45,6 +59,7 @@ type cfgType struct {
 		Pipe_Backend_Target        []string
 		Log_Level                  string
 		Ingest_Cache_Path          string
+		Config_Include_Directory   string //directory of additional *.conf files containing [Follower] sections
 	}
 	Follower map[string]*FollowType
 }
@@ -76,12 +91,175 @@ func GetConfig(path string) (*cfgType, error) {
 	if err := gcfg.ReadStringInto(&c, string(content)); err != nil {
 		return nil, err
 	}
+	if err := c.loadIncludes(); err != nil {
+		return nil, err
+	}
+	if err := c.resolve(); err != nil {
+		return nil, err
+	}
 	if err := verifyConfig(c); err != nil {
 		return nil, err
 	}
 	return &c, nil
 }
 
+//loadIncludes reads every *.conf file under Global.Config_Include_Directory
+//in lexical order and merges their [Follower "..."] sections into
+//c.Follower. It is a no-op if Config_Include_Directory is unset. A
+//follower name that collides with one already present (from the main
+//file or an earlier include) is a hard error, as is exceeding the
+//per-file or aggregate size caps.
+func (c *cfgType) loadIncludes() error {
+	dir := c.Global.Config_Include_Directory
+	if dir == `` {
+		return nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, includeGlob))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	var total int64
+	for _, p := range matches {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if fi.Size() > MAX_CONFIG_SIZE {
+			return fmt.Errorf("include file %s is far too large", p)
+		}
+		total += fi.Size()
+		if total > MAX_TOTAL_INCLUDE_SIZE {
+			return fmt.Errorf("total size of included config files under %s exceeds %d bytes", dir, MAX_TOTAL_INCLUDE_SIZE)
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var inc cfgType
+		if err := gcfg.ReadStringInto(&inc, string(content)); err != nil {
+			return fmt.Errorf("failed to parse include file %s: %v", p, err)
+		}
+		for name, v := range inc.Follower {
+			if _, ok := c.Follower[name]; ok {
+				return fmt.Errorf("duplicate follower %q in include file %s", name, p)
+			}
+			if c.Follower == nil {
+				c.Follower = make(map[string]*FollowType, 1)
+			}
+			c.Follower[name] = v
+		}
+	}
+	return nil
+}
+
+//resolve walks the config expanding environment variables and @file:
+//secret references in string fields before the values are handed off to
+//the rest of the ingester. It must run before verifyConfig so that
+//validation sees fully resolved values.
+func (c *cfgType) resolve() error {
+	var err error
+	if c.Global.Ingest_Secret, err = resolveValue(`Ingest-Secret`, c.Global.Ingest_Secret); err != nil {
+		return err
+	}
+	if c.Global.State_Store_Location, err = resolveValue(`State-Store-Location`, c.Global.State_Store_Location); err != nil {
+		return err
+	}
+	if c.Global.Ingest_Cache_Path, err = resolveValue(`Ingest-Cache-Path`, c.Global.Ingest_Cache_Path); err != nil {
+		return err
+	}
+	if c.Global.Cleartext_Backend_Target, err = resolveValues(`Cleartext-Backend-Target`, c.Global.Cleartext_Backend_Target); err != nil {
+		return err
+	}
+	if c.Global.Encrypted_Backend_Target, err = resolveValues(`Encrypted-Backend-Target`, c.Global.Encrypted_Backend_Target); err != nil {
+		return err
+	}
+	if c.Global.Pipe_Backend_Target, err = resolveValues(`Pipe-Backend-Target`, c.Global.Pipe_Backend_Target); err != nil {
+		return err
+	}
+	for k, v := range c.Follower {
+		if v.Base_Directory, err = resolveValue(fmt.Sprintf("Base-Directory for %s", k), v.Base_Directory); err != nil {
+			return err
+		}
+		if v.File_Filter, err = resolveValue(fmt.Sprintf("File-Filter for %s", k), v.File_Filter); err != nil {
+			return err
+		}
+		if v.Tag_Name, err = resolveValue(fmt.Sprintf("Tag-Name for %s", k), v.Tag_Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//resolveValues is a small helper to run resolveValue across a slice of
+//values that share the same field name (e.g. repeated config directives).
+func resolveValues(field string, vals []string) ([]string, error) {
+	for i := range vals {
+		v, err := resolveValue(field, vals[i])
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+//resolveValue expands ${VAR} / $VAR references via the shell/environment
+//and, if the value is the @file: sentinel, reads the referenced secret
+//file instead. Errors name the offending field so a bad deploy-time
+//substitution is easy to track down.
+func resolveValue(field, val string) (string, error) {
+	if strings.HasPrefix(val, secretFilePrefix) {
+		path, err := expandEnv(field, strings.TrimPrefix(val, secretFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return readSecretFile(field, path)
+	}
+	return expandEnv(field, val)
+}
+
+//expandEnv expands ${VAR} / $VAR references in val, returning an error
+//naming field if a referenced variable is not set in the environment.
+func expandEnv(field, val string) (string, error) {
+	var missing string
+	expanded := os.Expand(val, func(name string) string {
+		v, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return v
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %q referenced by %s is not set", missing, field)
+	}
+	return expanded, nil
+}
+
+//readSecretFile reads and trims a referenced secret file, enforcing a
+//sane size cap so a misconfigured @file: reference (e.g. pointing at a
+//directory or a huge file) fails loudly instead of silently truncating.
+func readSecretFile(field, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("empty @file: reference for %s", field)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat secret file for %s: %v", field, err)
+	}
+	if fi.IsDir() {
+		return "", fmt.Errorf("@file: reference for %s points at a directory: %s", field, path)
+	}
+	if fi.Size() > MAX_SECRET_FILE_SIZE {
+		return "", fmt.Errorf("secret file for %s exceeds %d bytes: %s", field, MAX_SECRET_FILE_SIZE, path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file for %s: %v", field, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
 func verifyConfig(c cfgType) error {
 	if to, err := c.parseTimeout(); err != nil || to < 0 {
 		if err != nil {
@@ -113,6 +291,18 @@ func verifyConfig(c cfgType) error {
 			return errors.New("Invalid characters in the Tag-Name for " + k)
 		}
 		v.Base_Directory = filepath.Clean(v.Base_Directory)
+		if _, err := v.startRegex(); err != nil {
+			return fmt.Errorf("Invalid Multiline-Start-Regex for %s: %v", k, err)
+		}
+		if _, err := v.timestampRegex(); err != nil {
+			return fmt.Errorf("Invalid Timestamp-Regex for %s: %v", k, err)
+		}
+		if _, err := v.flushTimeout(); err != nil {
+			return fmt.Errorf("Invalid Multiline-Flush-Timeout for %s: %v", k, err)
+		}
+		if v.Multiline_Start_Regex != `` && v.Multiline_Max_Lines <= 0 && v.Multiline_Flush_Timeout == `` {
+			return fmt.Errorf("Multiline-Start-Regex for %s requires Multiline-Max-Lines or Multiline-Flush-Timeout to bound a pending record", k)
+		}
 	}
 	return nil
 }
@@ -191,6 +381,36 @@ func (c *cfgType) StatePath() string {
 	return c.Global.State_Store_Location
 }
 
+//MultilineEnabled reports whether this follower assembles multi-line
+//records rather than treating every line as its own entry.
+func (f *FollowType) MultilineEnabled() bool {
+	return f.Multiline_Start_Regex != ``
+}
+
+//startRegex compiles Multiline_Start_Regex, returning nil, nil if unset.
+func (f *FollowType) startRegex() (*regexp.Regexp, error) {
+	if f.Multiline_Start_Regex == `` {
+		return nil, nil
+	}
+	return regexp.Compile(f.Multiline_Start_Regex)
+}
+
+//timestampRegex compiles Timestamp_Regex, returning nil, nil if unset.
+func (f *FollowType) timestampRegex() (*regexp.Regexp, error) {
+	if f.Timestamp_Regex == `` {
+		return nil, nil
+	}
+	return regexp.Compile(f.Timestamp_Regex)
+}
+
+//flushTimeout parses Multiline_Flush_Timeout, returning 0, nil if unset.
+func (f *FollowType) flushTimeout() (time.Duration, error) {
+	if f.Multiline_Flush_Timeout == `` {
+		return 0, nil
+	}
+	return time.ParseDuration(f.Multiline_Flush_Timeout)
+}
+
 func (c *cfgType) Followers() map[string]FollowType {
 	mp := make(map[string]FollowType, len(c.Follower))
 	for k, v := range c.Follower {
@@ -0,0 +1,130 @@
+/*************************************************************************
+ * Copyright 2018 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveValuePlain(t *testing.T) {
+	v, err := resolveValue(`Tag-Name`, `default`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != `default` {
+		t.Fatalf("expected %q, got %q", `default`, v)
+	}
+}
+
+func TestResolveValueEnvExpansion(t *testing.T) {
+	os.Setenv(`WINFILEFOLLOW_TEST_VAR`, `expanded`)
+	defer os.Unsetenv(`WINFILEFOLLOW_TEST_VAR`)
+
+	v, err := resolveValue(`Base-Directory`, `/opt/${WINFILEFOLLOW_TEST_VAR}/logs`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != `/opt/expanded/logs` {
+		t.Fatalf("expected %q, got %q", `/opt/expanded/logs`, v)
+	}
+}
+
+func TestResolveValueMissingEnv(t *testing.T) {
+	os.Unsetenv(`WINFILEFOLLOW_TEST_MISSING`)
+	if _, err := resolveValue(`Ingest-Secret`, `$WINFILEFOLLOW_TEST_MISSING`); err == nil {
+		t.Fatalf("expected error for unset environment variable, got nil")
+	}
+}
+
+func TestResolveValueSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, `secret`)
+	if err := ioutil.WriteFile(path, []byte("  s3kr1t\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+
+	v, err := resolveValue(`Ingest-Secret`, secretFilePrefix+path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != `s3kr1t` {
+		t.Fatalf("expected %q, got %q", `s3kr1t`, v)
+	}
+}
+
+func TestResolveValueSecretFileMissing(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := resolveValue(`Ingest-Secret`, secretFilePrefix+filepath.Join(dir, `nope`)); err == nil {
+		t.Fatalf("expected error for missing secret file, got nil")
+	}
+}
+
+func TestResolveValueSecretFileTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, `big`)
+	if err := ioutil.WriteFile(path, make([]byte, MAX_SECRET_FILE_SIZE+1), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+	if _, err := resolveValue(`Ingest-Secret`, secretFilePrefix+path); err == nil {
+		t.Fatalf("expected error for oversized secret file, got nil")
+	}
+}
+
+func writeIncludeFile(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+		t.Fatalf("failed to write include file %s: %v", name, err)
+	}
+}
+
+func TestLoadIncludesMergesDistinctFollowers(t *testing.T) {
+	dir := t.TempDir()
+	writeIncludeFile(t, dir, `one.conf`, "[Follower \"one\"]\nBase-Directory=/var/log/one\n")
+	writeIncludeFile(t, dir, `two.conf`, "[Follower \"two\"]\nBase-Directory=/var/log/two\n")
+
+	c := &cfgType{}
+	c.Global.Config_Include_Directory = dir
+	if err := c.loadIncludes(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Follower) != 2 {
+		t.Fatalf("expected 2 followers merged in, got %d", len(c.Follower))
+	}
+	if c.Follower[`one`] == nil || c.Follower[`one`].Base_Directory != `/var/log/one` {
+		t.Fatalf("follower %q not merged correctly: %+v", `one`, c.Follower[`one`])
+	}
+}
+
+func TestLoadIncludesRejectsDuplicateFollowerAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeIncludeFile(t, dir, `one.conf`, "[Follower \"dup\"]\nBase-Directory=/var/log/one\n")
+	writeIncludeFile(t, dir, `two.conf`, "[Follower \"dup\"]\nBase-Directory=/var/log/two\n")
+
+	c := &cfgType{}
+	c.Global.Config_Include_Directory = dir
+	if err := c.loadIncludes(); err == nil {
+		t.Fatalf("expected duplicate follower name across include files to be an error")
+	}
+}
+
+func TestLoadIncludesRejectsDuplicateAgainstMainFile(t *testing.T) {
+	dir := t.TempDir()
+	writeIncludeFile(t, dir, `one.conf`, "[Follower \"dup\"]\nBase-Directory=/var/log/one\n")
+
+	c := &cfgType{Follower: map[string]*FollowType{
+		`dup`: {Base_Directory: `/var/log/main`},
+	}}
+	c.Global.Config_Include_Directory = dir
+	if err := c.loadIncludes(); err == nil {
+		t.Fatalf("expected follower name colliding with the main config file to be an error")
+	}
+}
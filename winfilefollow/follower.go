@@ -0,0 +1,221 @@
+/*************************************************************************
+ * Copyright 2018 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tailPollInterval   = time.Second
+	fileRescanInterval = 5 * time.Second
+)
+
+//entrySink is the destination a FileFollower hands completed records to;
+//the muxer-backed implementation lives in main.go.
+type entrySink interface {
+	Ingest(tag string, ts time.Time, data []byte) error
+}
+
+//FileFollower tails every file in Base_Directory matching File_Filter
+//and feeds each line to an entrySink, either directly (one line, one
+//record) or through a recordAssembler when the follower is configured
+//for multiline assembly. It periodically re-globs so files created
+//under new paths after Start runs are picked up without a restart (a
+//path already being tailed is never reopened, so a file that replaces
+//it under the same name is not picked up), and
+//records each file's read offset in state so a restart resumes instead
+//of re-reading from the end and dropping whatever arrived in the
+//meantime.
+type FileFollower struct {
+	name      string
+	ft        FollowType
+	sink      entrySink
+	state     *stateStore
+	assembler *recordAssembler
+
+	closed chan struct{}
+	wg     sync.WaitGroup
+
+	mtx     sync.Mutex
+	tailing map[string]bool
+}
+
+//NewFileFollower builds a FileFollower for ft. If ft.MultilineEnabled()
+//a recordAssembler is built to flush assembled records to sink; ft is
+//assumed to have already passed verifyConfig. state persists each
+//tailed file's read offset; pass the same *stateStore to every
+//FileFollower sharing a config so they all persist to State_Store_Location.
+func NewFileFollower(name string, ft FollowType, sink entrySink, state *stateStore) (*FileFollower, error) {
+	ff := &FileFollower{
+		name:    name,
+		ft:      ft,
+		sink:    sink,
+		state:   state,
+		closed:  make(chan struct{}),
+		tailing: make(map[string]bool),
+	}
+	if ft.MultilineEnabled() {
+		ra, err := newRecordAssembler(ft, ff.emit)
+		if err != nil {
+			return nil, err
+		}
+		ff.assembler = ra
+	}
+	return ff, nil
+}
+
+//Start globs Base_Directory/File_Filter, spawns a tailing goroutine for
+//each matching file, and begins periodically re-globbing for files that
+//appear afterward under paths not already being tailed.
+func (ff *FileFollower) Start() error {
+	if err := ff.scan(); err != nil {
+		return err
+	}
+	ff.wg.Add(1)
+	go ff.rescanLoop()
+	return nil
+}
+
+//scan globs Base_Directory/File_Filter and spawns a tailing goroutine
+//for any match not already being tailed.
+func (ff *FileFollower) scan() error {
+	matches, err := filepath.Glob(filepath.Join(ff.ft.Base_Directory, ff.ft.File_Filter))
+	if err != nil {
+		return err
+	}
+	ff.mtx.Lock()
+	defer ff.mtx.Unlock()
+	for _, m := range matches {
+		if ff.tailing[m] {
+			continue
+		}
+		ff.tailing[m] = true
+		ff.wg.Add(1)
+		go ff.tail(m)
+	}
+	return nil
+}
+
+//rescanLoop periodically re-runs scan so files created after Start was
+//first called are still picked up.
+func (ff *FileFollower) rescanLoop() {
+	defer ff.wg.Done()
+	ticker := time.NewTicker(fileRescanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ff.closed:
+			return
+		case <-ticker.C:
+			ff.scan()
+		}
+	}
+}
+
+//Close stops all tailing goroutines and, for multiline followers,
+//flushes whatever record is still pending.
+func (ff *FileFollower) Close() error {
+	close(ff.closed)
+	ff.wg.Wait()
+	if ff.assembler != nil {
+		ff.assembler.Close()
+	}
+	return nil
+}
+
+//tail follows path, feeding each completed line to ff.feed. It polls
+//rather than relying on filesystem notifications to keep this follower
+//dependency-free. A file tailed for the first time starts at the
+//current end, same as tail -f, so its pre-existing contents aren't
+//replayed; a file state already has an offset for resumes from there,
+//and one found smaller than its recorded offset (truncated, or rotated
+//out from under us) is read from the start.
+func (ff *FileFollower) tail(path string) {
+	defer ff.wg.Done()
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	pos, known := ff.state.Offset(path)
+	switch {
+	case !known:
+		pos = fi.Size()
+	case pos > fi.Size():
+		pos = 0
+	}
+	if _, err := f.Seek(pos, io.SeekStart); err != nil {
+		return
+	}
+	ff.state.Set(path, pos)
+
+	reader := bufio.NewReader(f)
+	var partial strings.Builder
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ff.closed:
+			return
+		case <-ticker.C:
+		}
+		advanced := false
+		for {
+			chunk, err := reader.ReadString('\n')
+			if len(chunk) > 0 {
+				partial.WriteString(chunk)
+				pos += int64(len(chunk))
+				advanced = true
+			}
+			if err != nil {
+				//incomplete line (or real EOF); wait for more data next tick
+				break
+			}
+			line := strings.TrimSuffix(strings.TrimSuffix(partial.String(), "\n"), "\r")
+			partial.Reset()
+			ff.feed(path, []byte(line))
+		}
+		if advanced {
+			ff.state.Set(path, pos)
+		}
+	}
+}
+
+//feed routes a completed line either into the multiline assembler or,
+//for single-line followers, straight to the sink with the current time
+//as its timestamp (Ignore_Timestamps/Assume_Local_Timezone only affect
+//how a record's timestamp is derived once Timestamp_Regex is in play).
+func (ff *FileFollower) feed(src string, line []byte) {
+	if ff.assembler != nil {
+		ff.assembler.Feed(src, line)
+		return
+	}
+	ff.emit(src, line, time.Now(), true)
+}
+
+//emit is the flushFunc handed to the recordAssembler, and is also used
+//directly for non-multiline followers.
+func (ff *FileFollower) emit(src string, data []byte, ts time.Time, ok bool) {
+	if !ok {
+		ts = time.Now()
+	}
+	ff.sink.Ingest(ff.ft.Tag_Name, ts, data)
+}
@@ -0,0 +1,148 @@
+/*************************************************************************
+ * Copyright 2018 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gravwell/ingest"
+	"github.com/gravwell/ingest/entry"
+)
+
+var (
+	configPath = flag.String("config-file", "/opt/gravwell/etc/winfilefollow.conf", "Path to configuration file")
+	validate   = flag.Bool("validate", false, "Validate the configuration and exit without starting ingestion")
+)
+
+func main() {
+	flag.Parse()
+
+	cfg, err := GetConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *validate {
+		if err := cfg.Validate(os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := run(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+//run builds the ingest muxer and a FileFollower per configured follower,
+//then blocks until an interrupt or terminate signal is received.
+func run(cfg *cfgType) error {
+	targets, err := cfg.Targets()
+	if err != nil {
+		return err
+	}
+	tags, err := cfg.Tags()
+	if err != nil {
+		return err
+	}
+
+	muxCfg := ingest.UniformMuxerConfig{
+		Destinations: targets,
+		Tags:         tags,
+		Auth:         cfg.Secret(),
+		VerifyCert:   cfg.VerifyRemote(),
+		LogLevel:     cfg.LogLevel(),
+		IngesterName: "winfilefollow",
+	}
+	if cfg.CacheEnabled() {
+		muxCfg.EnableCache = true
+		muxCfg.CacheConfig = ingest.IngestCacheConfig{FileBackingLocation: cfg.CachePath()}
+	}
+	igst, err := ingest.NewUniformMuxer(muxCfg)
+	if err != nil {
+		return err
+	}
+	defer igst.Close()
+	if err := igst.Start(); err != nil {
+		return err
+	}
+	if err := igst.WaitForHot(cfg.Timeout()); err != nil {
+		return err
+	}
+
+	followerCfgs := cfg.Followers()
+
+	//negotiate every tag and populate the sink's map before any follower
+	//goroutine starts, so the concurrent reads in muxerSink.Ingest never
+	//race with a write here.
+	sink := &muxerSink{igst: igst, tags: make(map[string]entry.EntryTag)}
+	for _, ft := range followerCfgs {
+		if _, ok := sink.tags[ft.Tag_Name]; ok {
+			continue
+		}
+		tag, err := igst.NegotiateTag(ft.Tag_Name)
+		if err != nil {
+			return fmt.Errorf("failed to negotiate tag %s: %v", ft.Tag_Name, err)
+		}
+		sink.tags[ft.Tag_Name] = tag
+	}
+
+	state, err := newStateStore(cfg.StatePath())
+	if err != nil {
+		return fmt.Errorf("failed to load state store: %v", err)
+	}
+
+	var followers []*FileFollower
+	for name, ft := range followerCfgs {
+		ff, err := NewFileFollower(name, ft, sink, state)
+		if err != nil {
+			return fmt.Errorf("failed to build follower %s: %v", name, err)
+		}
+		if err := ff.Start(); err != nil {
+			return fmt.Errorf("failed to start follower %s: %v", name, err)
+		}
+		followers = append(followers, ff)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	for _, ff := range followers {
+		ff.Close()
+	}
+	return nil
+}
+
+//muxerSink adapts an ingest.IngestMuxer to the entrySink interface that
+//FileFollower writes completed records to.
+type muxerSink struct {
+	igst *ingest.IngestMuxer
+	tags map[string]entry.EntryTag
+}
+
+func (m *muxerSink) Ingest(tag string, ts time.Time, data []byte) error {
+	tg, ok := m.tags[tag]
+	if !ok {
+		return errors.New("unknown tag " + tag)
+	}
+	return m.igst.WriteEntry(&entry.Entry{
+		TS:   entry.FromStandard(ts),
+		Tag:  tg,
+		Data: data,
+	})
+}
@@ -0,0 +1,212 @@
+/*************************************************************************
+ * Copyright 2018 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//flushFunc is invoked with an assembled record once it is complete. src
+//identifies the file the record was read from; ts is the timestamp to
+//attach, or the zero Value if none could be extracted, in which case
+//the caller supplies its own (FileFollower.emit uses the current time).
+type flushFunc func(src string, data []byte, ts time.Time, ok bool)
+
+//recordAssembler accumulates consecutive lines from one or more source
+//files into multi-line records per a FollowType's Multiline_Start_Regex
+//configuration. A line that matches the start regex (or an empty
+//pending buffer) begins a new record; everything else is treated as a
+//continuation of the previous line and appended.
+type recordAssembler struct {
+	ft        FollowType
+	start     *regexp.Regexp
+	tsRegex   *regexp.Regexp
+	flushTO   time.Duration
+	flush     flushFunc
+	localZone bool
+
+	mtx     sync.Mutex
+	pending map[string]*pendingRecord
+
+	closed chan struct{}
+	wg     sync.WaitGroup
+}
+
+type pendingRecord struct {
+	buff    bytes.Buffer
+	lines   int
+	lastHit time.Time
+}
+
+//newRecordAssembler builds a recordAssembler for ft. ft is assumed to
+//have already passed verifyConfig, so its regexes and durations are
+//known-good.
+func newRecordAssembler(ft FollowType, flush flushFunc) (*recordAssembler, error) {
+	start, err := ft.startRegex()
+	if err != nil {
+		return nil, err
+	}
+	tsRegex, err := ft.timestampRegex()
+	if err != nil {
+		return nil, err
+	}
+	flushTO, err := ft.flushTimeout()
+	if err != nil {
+		return nil, err
+	}
+	ra := &recordAssembler{
+		ft:        ft,
+		start:     start,
+		tsRegex:   tsRegex,
+		flushTO:   flushTO,
+		flush:     flush,
+		localZone: ft.Assume_Local_Timezone,
+		pending:   make(map[string]*pendingRecord),
+		closed:    make(chan struct{}),
+	}
+	if ra.flushTO > 0 {
+		ra.wg.Add(1)
+		go ra.flushTicker()
+	}
+	return ra, nil
+}
+
+//Feed hands a single line read from src to the assembler. Lines that do
+//not match Multiline_Start_Regex are appended to the pending record for
+//src; a matching line (or an empty pending buffer) flushes whatever was
+//pending and starts a new record.
+func (ra *recordAssembler) Feed(src string, line []byte) {
+	ra.mtx.Lock()
+	defer ra.mtx.Unlock()
+	pr, ok := ra.pending[src]
+	if !ok {
+		pr = &pendingRecord{}
+		ra.pending[src] = pr
+	}
+	isStart := pr.buff.Len() == 0 || (ra.start != nil && ra.start.Match(line))
+	if isStart && pr.buff.Len() > 0 {
+		ra.flushRecord(src, pr)
+	}
+	if pr.buff.Len() > 0 {
+		pr.buff.WriteByte('\n')
+	}
+	pr.buff.Write(line)
+	pr.lines++
+	pr.lastHit = time.Now()
+	if ra.ft.Multiline_Max_Lines > 0 && pr.lines >= ra.ft.Multiline_Max_Lines {
+		ra.flushRecord(src, pr)
+	}
+}
+
+//Close flushes any pending records and stops the background flush
+//ticker.
+func (ra *recordAssembler) Close() {
+	close(ra.closed)
+	ra.wg.Wait()
+	ra.mtx.Lock()
+	defer ra.mtx.Unlock()
+	for src, pr := range ra.pending {
+		ra.flushRecord(src, pr)
+	}
+}
+
+//flushRecord emits the pending record for src and resets its buffer.
+//Callers must hold ra.mtx.
+func (ra *recordAssembler) flushRecord(src string, pr *pendingRecord) {
+	if pr.buff.Len() == 0 {
+		return
+	}
+	data := append([]byte(nil), pr.buff.Bytes()...)
+	ts, ok := ra.extractTimestamp(data)
+	ra.flush(src, data, ts, ok)
+	pr.buff.Reset()
+	pr.lines = 0
+}
+
+//extractTimestamp pulls the configured timestamp substring out of data
+//and parses it with Timestamp_Format_Override. If Ignore_Timestamps is
+//set, or Timestamp_Regex/Timestamp_Format_Override is unset, or the
+//parse fails, ok is false and the caller supplies its own timestamp.
+func (ra *recordAssembler) extractTimestamp(data []byte) (ts time.Time, ok bool) {
+	if ra.ft.Ignore_Timestamps {
+		return
+	}
+	if ra.tsRegex == nil || ra.ft.Timestamp_Format_Override == `` {
+		return
+	}
+	m := ra.tsRegex.FindSubmatch(data)
+	if len(m) == 0 {
+		return
+	}
+	match := m[0]
+	if len(m) > 1 && len(m[1]) > 0 {
+		match = m[1]
+	}
+	t, err := time.Parse(ra.ft.Timestamp_Format_Override, string(match))
+	if err != nil {
+		return
+	}
+	if ra.localZone && t.Location() == time.UTC && !layoutHasZone(ra.ft.Timestamp_Format_Override) {
+		if loc, lerr := time.LoadLocation("Local"); lerr == nil {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+		}
+	}
+	return t, true
+}
+
+//zoneLayoutVerbs are the reference-time substrings (see the time package
+//docs) that denote an explicit zone offset or name in a layout string.
+//time.Parse returns the time.UTC singleton both when a layout carries no
+//zone verb at all (genuinely zoneless, e.g. "2006-01-02 15:04:05") and
+//when it carries one that happened to resolve to a zero/UTC offset (e.g.
+//RFC3339 parsing a "...Z" timestamp) - only the former should have
+//Assume_Local_Timezone applied.
+var zoneLayoutVerbs = []string{
+	"Z0700", "Z07:00", "Z070000", "Z07:00:00", "Z07",
+	"-0700", "-07:00", "-070000", "-07:00:00", "-07",
+	"MST",
+}
+
+//layoutHasZone reports whether layout contains a reference-time zone
+//verb, meaning any zone it parses (including UTC) was explicit in the
+//source data rather than assumed.
+func layoutHasZone(layout string) bool {
+	for _, verb := range zoneLayoutVerbs {
+		if strings.Contains(layout, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+//flushTicker periodically flushes any pending record that has been
+//waiting longer than Multiline_Flush_Timeout.
+func (ra *recordAssembler) flushTicker() {
+	defer ra.wg.Done()
+	tk := time.NewTicker(ra.flushTO)
+	defer tk.Stop()
+	for {
+		select {
+		case <-ra.closed:
+			return
+		case now := <-tk.C:
+			ra.mtx.Lock()
+			for src, pr := range ra.pending {
+				if pr.buff.Len() > 0 && now.Sub(pr.lastHit) >= ra.flushTO {
+					ra.flushRecord(src, pr)
+				}
+			}
+			ra.mtx.Unlock()
+		}
+	}
+}
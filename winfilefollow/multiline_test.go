@@ -0,0 +1,138 @@
+/*************************************************************************
+ * Copyright 2018 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+//flushRecorder collects every flushFunc invocation for inspection, since
+//recordAssembler hands records to its caller asynchronously off the
+//flush ticker goroutine as well as synchronously from Feed/Close.
+type flushRecorder struct {
+	mtx sync.Mutex
+	got []string
+}
+
+func (r *flushRecorder) flush(src string, data []byte, ts time.Time, ok bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.got = append(r.got, string(data))
+}
+
+func (r *flushRecorder) records() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	out := make([]string, len(r.got))
+	copy(out, r.got)
+	return out
+}
+
+func TestRecordAssemblerFeedJoinsContinuationLines(t *testing.T) {
+	rec := &flushRecorder{}
+	ft := FollowType{Multiline_Start_Regex: `^\d{4}-`}
+	ra, err := newRecordAssembler(ft, rec.flush)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ra.Close()
+
+	ra.Feed(`a.log`, []byte(`2020-01-01 start of record`))
+	ra.Feed(`a.log`, []byte(`  continuation one`))
+	ra.Feed(`a.log`, []byte(`  continuation two`))
+	ra.Feed(`a.log`, []byte(`2020-01-02 next record`))
+
+	got := rec.records()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 flushed record before Close, got %d: %v", len(got), got)
+	}
+	want := "2020-01-01 start of record\n  continuation one\n  continuation two"
+	if got[0] != want {
+		t.Fatalf("expected %q, got %q", want, got[0])
+	}
+}
+
+func TestRecordAssemblerFeedFlushesOnClose(t *testing.T) {
+	rec := &flushRecorder{}
+	ft := FollowType{Multiline_Start_Regex: `^\d{4}-`}
+	ra, err := newRecordAssembler(ft, rec.flush)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ra.Feed(`a.log`, []byte(`2020-01-01 only record`))
+	ra.Close()
+
+	got := rec.records()
+	if len(got) != 1 || got[0] != `2020-01-01 only record` {
+		t.Fatalf("expected pending record to flush on Close, got %v", got)
+	}
+}
+
+func TestRecordAssemblerFeedMaxLines(t *testing.T) {
+	rec := &flushRecorder{}
+	ft := FollowType{Multiline_Start_Regex: `^\d{4}-`, Multiline_Max_Lines: 2}
+	ra, err := newRecordAssembler(ft, rec.flush)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ra.Close()
+
+	ra.Feed(`a.log`, []byte(`2020-01-01 start`))
+	ra.Feed(`a.log`, []byte(`  continuation`))
+
+	got := rec.records()
+	if len(got) != 1 {
+		t.Fatalf("expected Multiline-Max-Lines to force a flush, got %d records: %v", len(got), got)
+	}
+}
+
+func TestRecordAssemblerFeedTracksSourcesIndependently(t *testing.T) {
+	rec := &flushRecorder{}
+	ft := FollowType{Multiline_Start_Regex: `^\d{4}-`}
+	ra, err := newRecordAssembler(ft, rec.flush)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ra.Feed(`a.log`, []byte(`2020-01-01 from a`))
+	ra.Feed(`b.log`, []byte(`2020-01-01 from b`))
+	ra.Feed(`a.log`, []byte(`  continued in a`))
+	ra.Close()
+
+	got := rec.records()
+	if len(got) != 2 {
+		t.Fatalf("expected one flushed record per source, got %d: %v", len(got), got)
+	}
+	found := map[string]bool{}
+	for _, r := range got {
+		found[r] = true
+	}
+	if !found["2020-01-01 from a\n  continued in a"] || !found["2020-01-01 from b"] {
+		t.Fatalf("records did not keep per-source buffers independent: %v", got)
+	}
+}
+
+func TestExtractTimestampHonorsIgnoreTimestamps(t *testing.T) {
+	ft := FollowType{
+		Timestamp_Regex:           `^(\S+)`,
+		Timestamp_Format_Override: time.RFC3339,
+		Ignore_Timestamps:         true,
+	}
+	ra, err := newRecordAssembler(ft, func(string, []byte, time.Time, bool) {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ra.Close()
+
+	if _, ok := ra.extractTimestamp([]byte(`2020-01-01T00:00:00Z some log line`)); ok {
+		t.Fatalf("expected extractTimestamp to skip extraction when Ignore_Timestamps is set")
+	}
+}
@@ -0,0 +1,96 @@
+/*************************************************************************
+ * Copyright 2018 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+//stateStore persists, per followed file path, the byte offset a
+//FileFollower last read up to, at State_Store_Location. Without this a
+//restart has no choice but to either replay a file's entire history or
+//skip straight to its end, silently dropping whatever was written while
+//the ingester was down.
+type stateStore struct {
+	path string
+
+	mtx     sync.Mutex
+	offsets map[string]int64
+}
+
+//newStateStore loads any existing state from path. A missing file is not
+//an error - it just means this is the first run. An empty path disables
+//persistence entirely; Offset always reports "unknown" and Set is a
+//no-op, which is the behavior this series had before state tracking
+//existed.
+func newStateStore(path string) (*stateStore, error) {
+	ss := &stateStore{path: path, offsets: make(map[string]int64)}
+	if path == `` {
+		return ss, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ss, nil
+		}
+		return nil, err
+	}
+	if len(content) == 0 {
+		return ss, nil
+	}
+	if err := json.Unmarshal(content, &ss.offsets); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+//Offset returns the last persisted read offset for path and whether one
+//was recorded at all - a file this stateStore has never seen is
+//reported as unknown rather than offset 0, so callers can tell "start
+//from the end, we've never tailed this before" apart from "we really do
+//know the offset is zero".
+func (ss *stateStore) Offset(path string) (off int64, known bool) {
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+	off, known = ss.offsets[path]
+	return
+}
+
+//Set records off as the last read offset for path and persists the
+//updated state to disk. A no-op if ss.path is unset.
+func (ss *stateStore) Set(path string, off int64) error {
+	if ss.path == `` {
+		return nil
+	}
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+	ss.offsets[path] = off
+	return ss.save()
+}
+
+//save writes the current state to ss.path via a temp file plus rename so
+//a crash mid-write can't corrupt the existing state file. Callers must
+//hold ss.mtx. A no-op if ss.path is unset.
+func (ss *stateStore) save() error {
+	if ss.path == `` {
+		return nil
+	}
+	content, err := json.Marshal(ss.offsets)
+	if err != nil {
+		return err
+	}
+	tmp := ss.path + `.tmp`
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ss.path)
+}
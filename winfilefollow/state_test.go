@@ -0,0 +1,57 @@
+/*************************************************************************
+ * Copyright 2018 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStateStoreUnknownUntilSet(t *testing.T) {
+	ss, err := newStateStore(filepath.Join(t.TempDir(), `state.json`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, known := ss.Offset(`/var/log/a.log`); known {
+		t.Fatalf("expected unknown offset for a file never Set")
+	}
+}
+
+func TestStateStoreSetAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `state.json`)
+	ss, err := newStateStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ss.Set(`/var/log/a.log`, 1234); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reloaded, err := newStateStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error reloading state: %v", err)
+	}
+	off, known := reloaded.Offset(`/var/log/a.log`)
+	if !known || off != 1234 {
+		t.Fatalf("expected persisted offset 1234, got %d (known=%v)", off, known)
+	}
+}
+
+func TestStateStoreEmptyPathDisablesPersistence(t *testing.T) {
+	ss, err := newStateStore(``)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ss.Set(`/var/log/a.log`, 42); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, known := ss.Offset(`/var/log/a.log`); known {
+		t.Fatalf("expected an empty path to never record offsets")
+	}
+}
@@ -0,0 +1,196 @@
+/*************************************************************************
+ * Copyright 2018 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//ValidateResult is one line of a Validate() report: a single follower or
+//target check along with its outcome.
+type ValidateResult struct {
+	Name string
+	Err  error
+}
+
+//OK reports whether this check passed.
+func (v ValidateResult) OK() bool {
+	return v.Err == nil
+}
+
+//String renders a ValidateResult as a single "OK"/"ERR" report line.
+func (v ValidateResult) String() string {
+	if v.OK() {
+		return fmt.Sprintf("OK   %s", v.Name)
+	}
+	return fmt.Sprintf("ERR  %s: %v", v.Name, v.Err)
+}
+
+//Validate performs every check verifyConfig does, plus a set of
+//deploy-time checks that can only be done against the live environment:
+//it resolves each follower's Base_Directory on disk, checks that its
+//File_Filter is a valid glob, dials each backend target in Targets()
+//with Timeout(), and confirms the parent directories of
+//State_Store_Location and Ingest_Cache_Path can be written. It prints a
+//structured OK/ERR report to w, one line per check (two per follower,
+//one per target, and one each for the state and cache paths), and
+//returns an error if any check failed.
+func (c *cfgType) Validate(w io.Writer) error {
+	if err := verifyConfig(*c); err != nil {
+		return err
+	}
+	var results []ValidateResult
+	for name, v := range c.Follower {
+		results = append(results, ValidateResult{
+			Name: fmt.Sprintf("follower %s base-directory %s", name, v.Base_Directory),
+			Err:  validateBaseDirectory(v.Base_Directory),
+		})
+		results = append(results, ValidateResult{
+			Name: fmt.Sprintf("follower %s file-filter %s", name, v.File_Filter),
+			Err:  validateFileFilter(v.File_Filter),
+		})
+	}
+	targets, err := c.Targets()
+	if err != nil {
+		return err
+	}
+	to := c.Timeout()
+	verify := c.VerifyRemote()
+	for _, t := range targets {
+		results = append(results, ValidateResult{
+			Name: fmt.Sprintf("target %s", t),
+			Err:  dialTarget(t, to, verify),
+		})
+	}
+	results = append(results, ValidateResult{
+		Name: fmt.Sprintf("state-store-location %s", c.StatePath()),
+		Err:  validateWritableParent(c.StatePath()),
+	})
+	if c.CacheEnabled() {
+		results = append(results, ValidateResult{
+			Name: fmt.Sprintf("ingest-cache-path %s", c.CachePath()),
+			Err:  validateWritableParent(c.CachePath()),
+		})
+	}
+	var failed bool
+	for _, r := range results {
+		fmt.Fprintln(w, r.String())
+		if !r.OK() {
+			failed = true
+		}
+	}
+	if failed {
+		return errors.New("one or more validation checks failed")
+	}
+	return nil
+}
+
+//validateBaseDirectory confirms dir exists, is a directory, and is
+//readable.
+func validateBaseDirectory(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+//validateFileFilter confirms filter is a syntactically valid glob.
+func validateFileFilter(filter string) error {
+	if filter == `` {
+		return nil
+	}
+	_, err := filepath.Match(filter, "a")
+	return err
+}
+
+//dialTarget opens (and immediately closes) a connection to target using
+//the scheme produced by Targets(): tcp:// and tls:// dial the network
+//address, pipe:// stats the local path. verify mirrors
+//Global.Verify_Remote_Certificates: when true, the tls:// case performs
+//a real certificate verification (hostname + chain) exactly as the live
+//ingester would, rather than always skipping it, so -validate can't
+//report OK on a target that will fail to connect for real.
+func dialTarget(target string, to time.Duration, verify bool) error {
+	switch {
+	case strings.HasPrefix(target, "pipe://"):
+		_, err := os.Stat(strings.TrimPrefix(target, "pipe://"))
+		return err
+	case strings.HasPrefix(target, "tls://"):
+		addr := strings.TrimPrefix(target, "tls://")
+		conn, err := net.DialTimeout("tcp", addr, to)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: !verify,
+		})
+		if to > 0 {
+			tlsConn.SetDeadline(time.Now().Add(to))
+		}
+		return tlsConn.Handshake()
+	case strings.HasPrefix(target, "tcp://"):
+		conn, err := net.DialTimeout("tcp", strings.TrimPrefix(target, "tcp://"), to)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	return fmt.Errorf("unknown target scheme: %s", target)
+}
+
+//validateWritableParent confirms the parent directory of path exists
+//and is writable, which is all we can check without actually creating
+//the file ourselves.
+func validateWritableParent(path string) error {
+	if path == `` {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	probe := filepath.Join(dir, ".gravwell-validate-probe")
+	f, err := os.OpenFile(probe, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	os.Remove(probe)
+	return nil
+}